@@ -0,0 +1,517 @@
+// This file contains authentication, role-based access control, and audit
+// logging for the control endpoints (/initiate, /terminate, and friends).
+// Three auth methods are supported side by side: local bcrypt-hashed
+// passwords, OIDC/OAuth2 with a JWT session cookie, and mTLS client certs.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/oauth2"
+)
+
+//
+// ----------- Roles -----------
+//
+
+// Role is an access level for the control endpoints. Roles are ordered:
+// an operator can do everything a viewer can, and an admin everything an
+// operator can.
+type Role int
+
+const (
+	RoleViewer Role = iota
+	RoleOperator
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "unknown"
+	}
+}
+
+func parseRole(s string) (Role, error) {
+	switch s {
+	case "viewer":
+		return RoleViewer, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return 0, fmt.Errorf("unknown role %q", s)
+	}
+}
+
+//
+// ----------- Config -----------
+//
+
+// LocalUser is one entry in the local users file.
+type LocalUser struct {
+	Username     string   `json:"username"`
+	PasswordHash string   `json:"password_hash"` // bcrypt
+	Role         string   `json:"role"`
+	ChildGlobs   []string `json:"child_globs,omitempty"` // which children an operator may initiate/terminate
+}
+
+// OIDCConfig configures the optional OIDC/OAuth2 login flow.
+type OIDCConfig struct {
+	IssuerURL    string `json:"issuer_url"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RedirectURL  string `json:"redirect_url"`
+}
+
+// AuthConfig is the on-disk config for all three auth methods.
+type AuthConfig struct {
+	SessionSecret  string      `json:"session_secret"` // HMAC key for session JWTs
+	Users          []LocalUser `json:"users"`
+	OIDC           *OIDCConfig `json:"oidc,omitempty"`
+	ClientCAFile   string      `json:"client_ca_file,omitempty"`    // enables mTLS when set
+	CertCNRoleFile string      `json:"cert_cn_role_file,omitempty"` // maps client-cert CN -> role
+	AuditLogPath   string      `json:"audit_log_path"`
+}
+
+func loadAuthConfig(path string) (*AuthConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read auth config: %w", err)
+	}
+	var cfg AuthConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse auth config: %w", err)
+	}
+	if cfg.AuditLogPath == "" {
+		cfg.AuditLogPath = "govpnui-audit.log"
+	}
+	return &cfg, nil
+}
+
+//
+// ----------- principal -----------
+//
+
+// principal identifies the authenticated caller and what they're allowed
+// to do.
+type principal struct {
+	Username   string
+	Role       Role
+	ChildGlobs []string // empty means "all children" for non-operator roles
+	Method     string   // "local", "oidc", or "mtls", for the audit log
+}
+
+type principalKey struct{}
+
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(principal)
+	return p, ok
+}
+
+//
+// ----------- authenticator -----------
+//
+
+// authenticator backs the auth middleware: local users, OIDC session
+// cookies, and mTLS client certs.
+type authenticator struct {
+	cfg *AuthConfig
+
+	// secureCookies gates the session cookie's Secure flag. It must match
+	// whether the server is actually listening with TLS (see main.go): a
+	// browser silently drops a Secure cookie sent over plain HTTP, which
+	// would otherwise make every post-login request look unauthenticated.
+	secureCookies bool
+
+	mu        sync.RWMutex
+	users     map[string]LocalUser
+	certRoles map[string]Role // client cert CN -> role
+
+	oidcProvider *oidcVerifier
+	oauth2Conf   *oauth2.Config
+
+	audit *auditLogger
+}
+
+func newAuthenticator(cfg *AuthConfig, secureCookies bool) (*authenticator, error) {
+	a := &authenticator{cfg: cfg, secureCookies: secureCookies, users: make(map[string]LocalUser)}
+	for _, u := range cfg.Users {
+		a.users[u.Username] = u
+	}
+
+	if cfg.CertCNRoleFile != "" {
+		roles, err := loadCertCNRoles(cfg.CertCNRoleFile)
+		if err != nil {
+			return nil, err
+		}
+		a.certRoles = roles
+	}
+
+	if cfg.OIDC != nil {
+		verifier, err := newOIDCVerifier(cfg.OIDC.IssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("oidc: %w", err)
+		}
+		a.oidcProvider = verifier
+		a.oauth2Conf = &oauth2.Config{
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Endpoint:     verifier.Endpoint,
+			Scopes:       []string{"openid", "profile", "email"},
+		}
+	}
+
+	audit, err := newAuditLogger(cfg.AuditLogPath)
+	if err != nil {
+		return nil, err
+	}
+	a.audit = audit
+
+	return a, nil
+}
+
+func loadCertCNRoles(path string) (map[string]Role, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read cert CN role map: %w", err)
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse cert CN role map: %w", err)
+	}
+	out := make(map[string]Role, len(raw))
+	for cn, roleName := range raw {
+		role, err := parseRole(roleName)
+		if err != nil {
+			return nil, err
+		}
+		out[cn] = role
+	}
+	return out, nil
+}
+
+// authenticate inspects the request for a client cert, a session cookie,
+// or HTTP basic auth (against the local user store), in that order.
+func (a *authenticator) authenticate(r *http.Request) (principal, error) {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return a.authenticateCert(r.TLS.PeerCertificates[0])
+	}
+	if cookie, err := r.Cookie("govpnui_session"); err == nil {
+		return a.authenticateSessionCookie(cookie.Value)
+	}
+	if username, password, ok := r.BasicAuth(); ok {
+		return a.authenticateLocal(username, password)
+	}
+	return principal{}, errors.New("no credentials presented")
+}
+
+func (a *authenticator) authenticateCert(cert *x509.Certificate) (principal, error) {
+	a.mu.RLock()
+	role, ok := a.certRoles[cert.Subject.CommonName]
+	a.mu.RUnlock()
+	if !ok {
+		return principal{}, fmt.Errorf("no role mapped for client cert CN %q", cert.Subject.CommonName)
+	}
+	return principal{Username: cert.Subject.CommonName, Role: role, Method: "mtls"}, nil
+}
+
+func (a *authenticator) authenticateLocal(username, password string) (principal, error) {
+	a.mu.RLock()
+	user, ok := a.users[username]
+	a.mu.RUnlock()
+	if !ok {
+		return principal{}, errors.New("unknown user")
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return principal{}, errors.New("bad password")
+	}
+	role, err := parseRole(user.Role)
+	if err != nil {
+		return principal{}, err
+	}
+	return principal{Username: username, Role: role, ChildGlobs: user.ChildGlobs, Method: "local"}, nil
+}
+
+// sessionClaims is the JWT payload set in the govpnui_session cookie after
+// a successful local or OIDC login.
+type sessionClaims struct {
+	jwt.RegisteredClaims
+	Role       string   `json:"role"`
+	ChildGlobs []string `json:"child_globs,omitempty"`
+	Method     string   `json:"method"`
+}
+
+func (a *authenticator) issueSessionCookie(w http.ResponseWriter, p principal) {
+	claims := sessionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   p.Username,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(12 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+		Role:       p.Role.String(),
+		ChildGlobs: p.ChildGlobs,
+		Method:     p.Method,
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString([]byte(a.cfg.SessionSecret))
+	if err != nil {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     "govpnui_session",
+		Value:    signed,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   a.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Now().Add(12 * time.Hour),
+	})
+}
+
+func (a *authenticator) authenticateSessionCookie(raw string) (principal, error) {
+	var claims sessionClaims
+	token, err := jwt.ParseWithClaims(raw, &claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(a.cfg.SessionSecret), nil
+	})
+	if err != nil || !token.Valid {
+		return principal{}, fmt.Errorf("invalid session: %w", err)
+	}
+	role, err := parseRole(claims.Role)
+	if err != nil {
+		return principal{}, err
+	}
+	return principal{Username: claims.Subject, Role: role, ChildGlobs: claims.ChildGlobs, Method: claims.Method}, nil
+}
+
+// canOperate reports whether p may initiate/terminate the given child.
+func (p principal) canOperate(child string) bool {
+	if p.Role == RoleAdmin {
+		return true
+	}
+	if p.Role != RoleOperator {
+		return false
+	}
+	if len(p.ChildGlobs) == 0 {
+		return true
+	}
+	for _, pattern := range p.ChildGlobs {
+		if ok, err := path.Match(pattern, child); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// ----------- middleware -----------
+//
+
+var globalAuth *authenticator
+
+// requireRole wraps a handler so that it only runs for callers authenticated
+// at minRole or above, writing audit records for anything that isn't a pure
+// read. Child-scoped operator checks happen in the wrapped handlers
+// themselves via canOperate, since only they know the "name" parameter.
+func requireRole(minRole Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if globalAuth == nil {
+			// Auth not configured: behave like the old, unauthenticated build.
+			next(w, r)
+			return
+		}
+
+		p, err := globalAuth.authenticate(r)
+		if err != nil {
+			http.Error(w, "unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if p.Role < minRole {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalKey{}, p)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+//
+// ----------- audit log -----------
+//
+
+// AuditRecord is one structured entry in the audit log.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Username  string    `json:"username"`
+	Method    string    `json:"method"`
+	Action    string    `json:"action"`
+	Child     string    `json:"child,omitempty"`
+	SourceIP  string    `json:"source_ip"`
+	Result    string    `json:"result"`
+	ErrDetail string    `json:"error,omitempty"`
+}
+
+// auditLogger appends JSON-lines audit records to a log file, rotating it
+// once it crosses maxBytes.
+type auditLogger struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	f        *os.File
+}
+
+func newAuditLogger(path string) (*auditLogger, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return &auditLogger{path: path, maxBytes: 50 * 1024 * 1024, f: f}, nil
+}
+
+func (l *auditLogger) record(rec AuditRecord) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if info, err := l.f.Stat(); err == nil && info.Size()+int64(len(line)) > l.maxBytes {
+		l.rotateLocked()
+	}
+	l.f.Write(line)
+}
+
+func (l *auditLogger) rotateLocked() {
+	l.f.Close()
+	rotated := fmt.Sprintf("%s.%d", l.path, time.Now().Unix())
+	os.Rename(l.path, rotated)
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	l.f = f
+}
+
+// auditControlCall records an initiate/terminate/conn-lifecycle call. Call
+// it from the handler after it knows the outcome.
+func auditControlCall(r *http.Request, action, child string, err error) {
+	if globalAuth == nil {
+		return
+	}
+	p, _ := principalFromContext(r.Context())
+	result := "ok"
+	detail := ""
+	if err != nil {
+		result = "error"
+		detail = err.Error()
+	}
+	globalAuth.audit.record(AuditRecord{
+		Time:      time.Now(),
+		Username:  p.Username,
+		Method:    p.Method,
+		Action:    action,
+		Child:     child,
+		SourceIP:  sourceIP(r),
+		Result:    result,
+		ErrDetail: detail,
+	})
+}
+
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//
+// ----------- TLS with auto-reloaded certs -----------
+//
+
+// reloadingCert serves a TLS certificate from disk, reloading it whenever
+// the files' modification time changes so renewed certs take effect without
+// a restart.
+type reloadingCert struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	loadedAt time.Time
+	cert     *tls.Certificate
+}
+
+func newReloadingCert(certFile, keyFile string) *reloadingCert {
+	return &reloadingCert{certFile: certFile, keyFile: keyFile}
+}
+
+func (r *reloadingCert) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	info, err := os.Stat(r.certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cert != nil && !info.ModTime().After(r.loadedAt) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			return r.cert, nil // keep serving the old cert rather than going dark
+		}
+		return nil, err
+	}
+	r.cert = &cert
+	r.loadedAt = time.Now()
+	return r.cert, nil
+}
+
+// listenAndServeTLS serves addr with the given handler using certs that
+// reload from disk on change, optionally requiring client certs for mTLS.
+func listenAndServeTLS(addr, certFile, keyFile, clientCAFile string, handler http.Handler) error {
+	rc := newReloadingCert(certFile, keyFile)
+	tlsConfig := &tls.Config{GetCertificate: rc.getCertificate}
+
+	if clientCAFile != "" {
+		caPEM, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return fmt.Errorf("read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return fmt.Errorf("no certs parsed from %s", clientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	server := &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig}
+	return server.ListenAndServeTLS("", "")
+}
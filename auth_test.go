@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseRole(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    Role
+		wantErr bool
+	}{
+		{"viewer", RoleViewer, false},
+		{"operator", RoleOperator, false},
+		{"admin", RoleAdmin, false},
+		{"superadmin", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parseRole(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("parseRole(%q): expected an error, got nil", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseRole(%q): unexpected error: %v", c.in, err)
+		}
+		if got != c.want {
+			t.Errorf("parseRole(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestCanOperate(t *testing.T) {
+	cases := []struct {
+		name  string
+		p     principal
+		child string
+		want  bool
+	}{
+		{"admin can operate anything", principal{Role: RoleAdmin}, "site-b", true},
+		{"viewer can't operate", principal{Role: RoleViewer}, "site-a", false},
+		{"operator with no globs can operate anything", principal{Role: RoleOperator}, "site-a", true},
+		{"operator matching glob", principal{Role: RoleOperator, ChildGlobs: []string{"site-a*"}}, "site-a-1", true},
+		{"operator not matching glob", principal{Role: RoleOperator, ChildGlobs: []string{"site-a*"}}, "site-b", false},
+	}
+	for _, c := range cases {
+		if got := c.p.canOperate(c.child); got != c.want {
+			t.Errorf("%s: canOperate(%q) = %v, want %v", c.name, c.child, got, c.want)
+		}
+	}
+}
+
+func TestIssueSessionCookieSecureFlagMatchesTLSConfig(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		a := &authenticator{cfg: &AuthConfig{SessionSecret: "test-secret"}, secureCookies: secure}
+		w := httptest.NewRecorder()
+		a.issueSessionCookie(w, principal{Username: "alice", Role: RoleViewer})
+
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("got %d cookies, want 1", len(cookies))
+		}
+		if cookies[0].Secure != secure {
+			t.Errorf("secureCookies=%v: cookie.Secure = %v, want %v", secure, cookies[0].Secure, secure)
+		}
+	}
+}
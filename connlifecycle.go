@@ -0,0 +1,506 @@
+// This file extends the VICI control surface beyond initiate/terminate to
+// full connection lifecycle management: /conn/create, /conn/update,
+// /conn/delete, and /conn/reload. Definitions are persisted as
+// swanctl.conf.d/*.conf fragments (atomic write + fsync + rename) so they
+// survive a charon restart, and pushed live via load-conn/unload-conn.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	vici "github.com/strongswan/govici/vici"
+)
+
+//
+// ----------- connection definition model -----------
+//
+
+// ChildDef describes one CHILD_SA within a connection, modeled on the
+// "children" section of swanctl.conf.
+type ChildDef struct {
+	Name         string   `json:"name"`
+	LocalTS      []string `json:"local_ts"`
+	RemoteTS     []string `json:"remote_ts"`
+	ESPProposals []string `json:"esp_proposals,omitempty"`
+	StartAction  string   `json:"start_action,omitempty"`
+}
+
+// ConnDef is the JSON definition of an IKE connection accepted by
+// /conn/create and /conn/update, modeled on swanctl.conf's "connections"
+// section.
+type ConnDef struct {
+	Name        string     `json:"name"`
+	LocalAddrs  []string   `json:"local_addrs"`
+	RemoteAddrs []string   `json:"remote_addrs"`
+	Proposals   []string   `json:"proposals,omitempty"`
+	LocalAuth   string     `json:"local_auth"` // e.g. "psk" or "pubkey"
+	LocalID     string     `json:"local_id,omitempty"`
+	RemoteAuth  string     `json:"remote_auth"`
+	RemoteID    string     `json:"remote_id,omitempty"`
+	PSK         string     `json:"psk,omitempty"`  // only meaningful when *Auth == "psk"
+	Cert        string     `json:"cert,omitempty"` // cert reference, only meaningful when *Auth == "pubkey"
+	Children    []ChildDef `json:"children"`
+}
+
+// validateConnDef rejects duplicate child names and overlapping traffic
+// selectors within the same connection, the two mistakes load-conn itself
+// won't catch until it's too late to give a useful error.
+func validateConnDef(def ConnDef) error {
+	if def.Name == "" {
+		return fmt.Errorf("connection name is required")
+	}
+	if !isSafeConnName(def.Name) {
+		return fmt.Errorf("invalid connection name %q", def.Name)
+	}
+	if len(def.Children) == 0 {
+		return fmt.Errorf("connection %q has no children", def.Name)
+	}
+
+	seen := make(map[string]struct{}, len(def.Children))
+	for _, c := range def.Children {
+		if c.Name == "" {
+			return fmt.Errorf("child name is required")
+		}
+		if _, dup := seen[c.Name]; dup {
+			return fmt.Errorf("duplicate child name %q", c.Name)
+		}
+		seen[c.Name] = struct{}{}
+	}
+
+	for i, a := range def.Children {
+		for j, b := range def.Children {
+			if i >= j {
+				continue
+			}
+			if tsOverlap(a.LocalTS, b.LocalTS) && tsOverlap(a.RemoteTS, b.RemoteTS) {
+				return fmt.Errorf("children %q and %q have overlapping traffic selectors", a.Name, b.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// tsOverlap is a literal-match check, not a CIDR-aware one; it catches the
+// common case of two children configured with the exact same selector.
+func tsOverlap(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//
+// ----------- in-memory definition store -----------
+//
+
+// connDefStore tracks the connection definitions we've pushed, so
+// /conn/reload can replay them over load-conn without re-parsing the
+// swanctl.conf.d fragments on disk.
+type connDefStore struct {
+	mu   sync.RWMutex
+	defs map[string]ConnDef
+}
+
+var globalConnDefs = &connDefStore{defs: make(map[string]ConnDef)}
+
+func (s *connDefStore) put(def ConnDef) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defs[def.Name] = def
+}
+
+func (s *connDefStore) lookup(name string) (ConnDef, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	def, ok := s.defs[name]
+	return def, ok
+}
+
+func (s *connDefStore) delete(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.defs, name)
+}
+
+func (s *connDefStore) all() []ConnDef {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]ConnDef, 0, len(s.defs))
+	for _, d := range s.defs {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+//
+// ----------- swanctl.conf.d fragments -----------
+//
+
+// swanctlConfDir is where managed connection fragments are written.
+var swanctlConfDir = "/etc/swanctl/conf.d"
+
+// renderSwanctlConf renders a ConnDef as a swanctl.conf "connections"
+// fragment, for both the dry-run response and the on-disk fragment.
+func renderSwanctlConf(def ConnDef) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "connections {\n  %s {\n", def.Name)
+	fmt.Fprintf(&b, "    local_addrs = %s\n", strings.Join(def.LocalAddrs, ","))
+	fmt.Fprintf(&b, "    remote_addrs = %s\n", strings.Join(def.RemoteAddrs, ","))
+	if len(def.Proposals) > 0 {
+		fmt.Fprintf(&b, "    proposals = %s\n", strings.Join(def.Proposals, ","))
+	}
+
+	fmt.Fprintf(&b, "    local {\n      auth = %s\n", def.LocalAuth)
+	if def.LocalID != "" {
+		fmt.Fprintf(&b, "      id = %s\n", def.LocalID)
+	}
+	if def.Cert != "" {
+		fmt.Fprintf(&b, "      certs = %s\n", def.Cert)
+	}
+	b.WriteString("    }\n")
+
+	fmt.Fprintf(&b, "    remote {\n      auth = %s\n", def.RemoteAuth)
+	if def.RemoteID != "" {
+		fmt.Fprintf(&b, "      id = %s\n", def.RemoteID)
+	}
+	b.WriteString("    }\n")
+
+	b.WriteString("    children {\n")
+	for _, c := range def.Children {
+		fmt.Fprintf(&b, "      %s {\n", c.Name)
+		fmt.Fprintf(&b, "        local_ts = %s\n", strings.Join(c.LocalTS, ","))
+		fmt.Fprintf(&b, "        remote_ts = %s\n", strings.Join(c.RemoteTS, ","))
+		if len(c.ESPProposals) > 0 {
+			fmt.Fprintf(&b, "        esp_proposals = %s\n", strings.Join(c.ESPProposals, ","))
+		}
+		if c.StartAction != "" {
+			fmt.Fprintf(&b, "        start_action = %s\n", c.StartAction)
+		}
+		b.WriteString("      }\n")
+	}
+	b.WriteString("    }\n  }\n}\n")
+
+	// The PSK lives in its own top-level "secrets" stanza, not under the
+	// connection itself - swanctl.conf and load-shared both treat shared
+	// keys as a separate namespace from connection definitions.
+	if def.PSK != "" {
+		fmt.Fprintf(&b, "secrets {\n  ike-%s {\n    secret = \"%s\"\n  }\n}\n", def.Name, def.PSK)
+	}
+	return b.String()
+}
+
+// isSafeConnName rejects anything that isn't a bare filename component, so
+// a connection name can never be used to escape swanctlConfDir via a path
+// separator or a ".." segment.
+func isSafeConnName(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	return !strings.ContainsAny(name, `/\`) && filepath.Base(name) == name
+}
+
+// writeConnFragment atomically (write + fsync + rename) persists a
+// connection fragment under swanctlConfDir.
+func writeConnFragment(name, contents string) error {
+	if !isSafeConnName(name) {
+		return fmt.Errorf("invalid connection name %q", name)
+	}
+	path := filepath.Join(swanctlConfDir, name+".conf")
+	tmp, err := os.CreateTemp(swanctlConfDir, "."+name+".conf.tmp-*")
+	if err != nil {
+		return fmt.Errorf("create temp fragment: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(contents); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write temp fragment: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("fsync temp fragment: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close temp fragment: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename fragment into place: %w", err)
+	}
+	return nil
+}
+
+func removeConnFragment(name string) error {
+	if !isSafeConnName(name) {
+		return fmt.Errorf("invalid connection name %q", name)
+	}
+	path := filepath.Join(swanctlConfDir, name+".conf")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove fragment: %w", err)
+	}
+	return nil
+}
+
+//
+// ----------- VICI load-conn / unload-conn -----------
+//
+
+func connDefToVICIMessage(def ConnDef) *vici.Message {
+	conn := vici.NewMessage()
+	conn.Set("local_addrs", def.LocalAddrs)
+	conn.Set("remote_addrs", def.RemoteAddrs)
+	if len(def.Proposals) > 0 {
+		conn.Set("proposals", def.Proposals)
+	}
+
+	local := vici.NewMessage()
+	local.Set("auth", def.LocalAuth)
+	if def.LocalID != "" {
+		local.Set("id", def.LocalID)
+	}
+	if def.Cert != "" {
+		local.Set("certs", []string{def.Cert})
+	}
+	conn.Set("local", local)
+
+	remote := vici.NewMessage()
+	remote.Set("auth", def.RemoteAuth)
+	if def.RemoteID != "" {
+		remote.Set("id", def.RemoteID)
+	}
+	conn.Set("remote", remote)
+
+	children := vici.NewMessage()
+	for _, c := range def.Children {
+		child := vici.NewMessage()
+		child.Set("local_ts", c.LocalTS)
+		child.Set("remote_ts", c.RemoteTS)
+		if len(c.ESPProposals) > 0 {
+			child.Set("esp_proposals", c.ESPProposals)
+		}
+		if c.StartAction != "" {
+			child.Set("start_action", c.StartAction)
+		}
+		children.Set(c.Name, child)
+	}
+	conn.Set("children", children)
+
+	msg := vici.NewMessage()
+	msg.Set(def.Name, conn)
+	return msg
+}
+
+func viciLoadConn(sess *vici.Session, def ConnDef) error {
+	if _, err := sess.CommandRequest("load-conn", connDefToVICIMessage(def)); err != nil {
+		return fmt.Errorf("load-conn %q: %w", def.Name, err)
+	}
+	return nil
+}
+
+// viciLoadSharedSecret pushes def's pre-shared key via load-shared. Shared
+// keys are a separate VICI namespace from connections - load-conn never sees
+// them - so this has to be called alongside viciLoadConn for any definition
+// with LocalAuth/RemoteAuth "psk", or charon has a connection but nothing to
+// authenticate it with. The key is scoped to the connection's own local/
+// remote identities when they're set, rather than installed as a global PSK.
+func viciLoadSharedSecret(sess *vici.Session, def ConnDef) error {
+	if def.PSK == "" {
+		return nil
+	}
+	msg := vici.NewMessage()
+	msg.Set("type", "IKE")
+	msg.Set("data", def.PSK)
+	var owners []string
+	if def.LocalID != "" {
+		owners = append(owners, def.LocalID)
+	}
+	if def.RemoteID != "" {
+		owners = append(owners, def.RemoteID)
+	}
+	if len(owners) > 0 {
+		msg.Set("owners", owners)
+	}
+	if _, err := sess.CommandRequest("load-shared", msg); err != nil {
+		return fmt.Errorf("load-shared %q: %w", def.Name, err)
+	}
+	return nil
+}
+
+func viciUnloadConn(sess *vici.Session, name string) error {
+	msg := vici.NewMessage()
+	msg.Set("name", name)
+	if _, err := sess.CommandRequest("unload-conn", msg); err != nil {
+		return fmt.Errorf("unload-conn %q: %w", name, err)
+	}
+	return nil
+}
+
+// viciLoadAll replays every known connection definition over load-conn,
+// mirroring what `swanctl --load-all` does against swanctl.conf.d, without
+// shelling out to swanctl.
+func viciLoadAll(sess *vici.Session) error {
+	for _, def := range globalConnDefs.all() {
+		if err := viciLoadConn(sess, def); err != nil {
+			return err
+		}
+		if err := viciLoadSharedSecret(sess, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//
+// ----------- /conn/create, /conn/update, /conn/delete, /conn/reload -----------
+//
+
+// connRequest wraps ConnDef with the dry-run flag accepted by
+// /conn/create and /conn/update.
+type connRequest struct {
+	ConnDef
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+type connResponse struct {
+	Rendered string `json:"rendered,omitempty"`
+	Applied  bool   `json:"applied"`
+}
+
+func connCreateHandler(w http.ResponseWriter, r *http.Request) {
+	connWriteHandler(w, r, false)
+}
+
+func connUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	connWriteHandler(w, r, true)
+}
+
+func connWriteHandler(w http.ResponseWriter, r *http.Request, isUpdate bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req connRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateConnDef(req.ConnDef); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if isUpdate {
+		if _, exists := globalConnDefs.lookup(req.Name); !exists {
+			http.Error(w, fmt.Sprintf("connection %q does not exist", req.Name), http.StatusNotFound)
+			return
+		}
+	}
+
+	resp := connResponse{Rendered: renderSwanctlConf(req.ConnDef)}
+	if req.DryRun {
+		writeConnJSON(w, resp)
+		return
+	}
+
+	if err := writeConnFragment(req.Name, resp.Rendered); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	globalConnDefs.put(req.ConnDef)
+
+	sess, err := viciSession()
+	if err != nil {
+		http.Error(w, "vici connect failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer sess.Close()
+
+	action := "conn.create"
+	if isUpdate {
+		action = "conn.update"
+	}
+	err = viciLoadConn(sess, req.ConnDef)
+	if err == nil {
+		err = viciLoadSharedSecret(sess, req.ConnDef)
+	}
+	auditControlCall(r, action, req.Name, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp.Applied = true
+	writeConnJSON(w, resp)
+}
+
+func connDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "missing query parameter: name", http.StatusBadRequest)
+		return
+	}
+	if !isSafeConnName(name) {
+		http.Error(w, fmt.Sprintf("invalid connection name %q", name), http.StatusBadRequest)
+		return
+	}
+
+	sess, err := viciSession()
+	if err != nil {
+		http.Error(w, "vici connect failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer sess.Close()
+
+	err = viciUnloadConn(sess, name)
+	auditControlCall(r, "conn.delete", name, err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := removeConnFragment(name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	globalConnDefs.delete(name)
+
+	w.Write([]byte("ok\n"))
+}
+
+func connReloadHandler(w http.ResponseWriter, r *http.Request) {
+	sess, err := viciSession()
+	if err != nil {
+		http.Error(w, "vici connect failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer sess.Close()
+
+	err = viciLoadAll(sess)
+	auditControlCall(r, "conn.reload", "", err)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func writeConnJSON(w http.ResponseWriter, resp connResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
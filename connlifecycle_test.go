@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIsSafeConnName(t *testing.T) {
+	cases := []struct {
+		name string
+		ok   bool
+	}{
+		{"office-vpn", true},
+		{"office_vpn.1", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{"../etc", false},
+		{"foo/../bar", false},
+		{"foo/bar", false},
+		{`foo\bar`, false},
+		{"/etc/passwd", false},
+	}
+	for _, c := range cases {
+		if got := isSafeConnName(c.name); got != c.ok {
+			t.Errorf("isSafeConnName(%q) = %v, want %v", c.name, got, c.ok)
+		}
+	}
+}
+
+func TestTsOverlap(t *testing.T) {
+	cases := []struct {
+		a, b []string
+		want bool
+	}{
+		{[]string{"10.0.0.0/24"}, []string{"10.0.0.0/24"}, true},
+		{[]string{"10.0.0.0/24"}, []string{"10.0.1.0/24"}, false},
+		{[]string{"10.0.0.0/24", "10.0.1.0/24"}, []string{"10.0.1.0/24"}, true},
+		{nil, []string{"10.0.0.0/24"}, false},
+	}
+	for _, c := range cases {
+		if got := tsOverlap(c.a, c.b); got != c.want {
+			t.Errorf("tsOverlap(%v, %v) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestValidateConnDefRejectsOverlappingChildren(t *testing.T) {
+	def := ConnDef{
+		Name: "office-vpn",
+		Children: []ChildDef{
+			{Name: "net-a", LocalTS: []string{"10.0.0.0/24"}, RemoteTS: []string{"0.0.0.0/0"}},
+			{Name: "net-b", LocalTS: []string{"10.0.0.0/24"}, RemoteTS: []string{"0.0.0.0/0"}},
+		},
+	}
+	if err := validateConnDef(def); err == nil {
+		t.Fatal("expected an error for overlapping traffic selectors, got nil")
+	}
+}
+
+func TestValidateConnDefRejectsUnsafeName(t *testing.T) {
+	def := ConnDef{
+		Name:     "../etc/swanctl",
+		Children: []ChildDef{{Name: "net-a", LocalTS: []string{"10.0.0.0/24"}, RemoteTS: []string{"0.0.0.0/0"}}},
+	}
+	if err := validateConnDef(def); err == nil {
+		t.Fatal("expected an error for an unsafe connection name, got nil")
+	}
+}
+
+func TestRenderSwanctlConfIncludesPSKSecret(t *testing.T) {
+	def := ConnDef{
+		Name:       "office-vpn",
+		LocalAuth:  "psk",
+		RemoteAuth: "psk",
+		PSK:        "supersecret",
+		Children:   []ChildDef{{Name: "net-a", LocalTS: []string{"10.0.0.0/24"}, RemoteTS: []string{"0.0.0.0/0"}}},
+	}
+	out := renderSwanctlConf(def)
+	if !strings.Contains(out, "secrets {") {
+		t.Fatalf("rendered config has no secrets stanza for a psk connection:\n%s", out)
+	}
+	if !strings.Contains(out, `secret = "supersecret"`) {
+		t.Fatalf("rendered config does not carry the configured PSK:\n%s", out)
+	}
+}
+
+func TestRenderSwanctlConfIncludesCert(t *testing.T) {
+	def := ConnDef{
+		Name:      "office-vpn",
+		LocalAuth: "pubkey",
+		Cert:      "client.pem",
+		Children:  []ChildDef{{Name: "net-a", LocalTS: []string{"10.0.0.0/24"}, RemoteTS: []string{"0.0.0.0/0"}}},
+	}
+	out := renderSwanctlConf(def)
+	if !strings.Contains(out, "certs = client.pem") {
+		t.Fatalf("rendered config does not reference the configured cert:\n%s", out)
+	}
+}
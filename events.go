@@ -0,0 +1,301 @@
+// This file contains the streaming event subsystem: a long-lived VICI
+// session subscribed to strongSwan's event stream, fanned out to browsers
+// over WebSocket and SSE so the UI doesn't have to poll /status_json.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	vici "github.com/strongswan/govici/vici"
+)
+
+// eventNames are the strongSwan events the UI cares about.
+var eventNames = []string{"ike-updown", "child-updown", "ike-rekey", "child-rekey", "log"}
+
+// Event is a single decoded VICI event, ready to fan out to browsers.
+type Event struct {
+	ID   uint64          `json:"id"`
+	Name string          `json:"name"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+// childEventState is the latest event-derived state known for one child SA.
+type childEventState struct {
+	State   string
+	Since   time.Time
+	RekeyIn int64 // seconds until next rekey, as last reported
+}
+
+// eventBus fans out VICI events to subscribers and keeps a ring buffer of
+// the last N events so reconnecting clients can replay via Last-Event-ID.
+type eventBus struct {
+	mu   sync.Mutex
+	next uint64
+	ring []Event
+	cap  int
+	subs map[chan Event]struct{}
+
+	childMu    sync.Mutex
+	childState map[string]childEventState
+}
+
+func newEventBus(ringSize int) *eventBus {
+	return &eventBus{
+		cap:        ringSize,
+		subs:       make(map[chan Event]struct{}),
+		childState: make(map[string]childEventState),
+	}
+}
+
+// globalEventBus is the process-wide event fan-out used by the /events/*
+// handlers and by statusJSONHandler to enrich ChildStats.
+var globalEventBus = newEventBus(256)
+
+func (b *eventBus) subscribe() (chan Event, []Event) {
+	ch := make(chan Event, 16)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[ch] = struct{}{}
+	backlog := make([]Event, len(b.ring))
+	copy(backlog, b.ring)
+	return ch, backlog
+}
+
+func (b *eventBus) unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[ch]; ok {
+		delete(b.subs, ch)
+		close(ch)
+	}
+}
+
+// since returns buffered events with ID greater than lastID, for clients
+// reconnecting with a Last-Event-ID header.
+func (b *eventBus) since(lastID uint64) []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []Event
+	for _, e := range b.ring {
+		if e.ID > lastID {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func (b *eventBus) publish(name string, msg *vici.Message) {
+	data, _ := json.Marshal(messageToMap(msg))
+
+	b.mu.Lock()
+	b.next++
+	ev := Event{ID: b.next, Name: name, Time: time.Now(), Data: data}
+	b.ring = append(b.ring, ev)
+	if len(b.ring) > b.cap {
+		b.ring = b.ring[len(b.ring)-b.cap:]
+	}
+	for ch := range b.subs {
+		select {
+		case ch <- ev:
+		default: // slow subscriber, drop rather than block the publisher
+		}
+	}
+	b.mu.Unlock()
+
+	b.trackChild(name, msg)
+
+	if name == "ike-rekey" {
+		for _, ikeName := range msg.Keys() {
+			recordIKERekeyEvent(ikeName)
+		}
+	}
+}
+
+// trackChild updates the event-derived Since/RekeyIn/State used to enrich
+// ChildStats, from child-updown and child-rekey payloads.
+func (b *eventBus) trackChild(name string, msg *vici.Message) {
+	if name != "child-updown" && name != "child-rekey" {
+		return
+	}
+	for _, childName := range msg.Keys() {
+		cm, ok := msg.Get(childName).(*vici.Message)
+		if !ok {
+			continue
+		}
+
+		b.childMu.Lock()
+		st := b.childState[childName]
+		if s, ok := cm.Get("state").(string); ok {
+			st.State = s
+		}
+		if name == "child-updown" {
+			st.Since = time.Now()
+		}
+		if r, ok := cm.Get("rekey-time").(string); ok {
+			if n, err := strconv.ParseInt(r, 10, 64); err == nil {
+				st.RekeyIn = n
+			}
+		}
+		b.childState[childName] = st
+		b.childMu.Unlock()
+	}
+}
+
+func (b *eventBus) childEventState(name string) (childEventState, bool) {
+	b.childMu.Lock()
+	defer b.childMu.Unlock()
+	st, ok := b.childState[name]
+	return st, ok
+}
+
+// messageToMap flattens a vici.Message into a JSON-friendly map; nested
+// sections become nested maps.
+func messageToMap(msg *vici.Message) map[string]interface{} {
+	out := make(map[string]interface{}, len(msg.Keys()))
+	for _, k := range msg.Keys() {
+		v := msg.Get(k)
+		if sub, ok := v.(*vici.Message); ok {
+			out[k] = messageToMap(sub)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+//
+// ----------- VICI event subscriber -----------
+//
+
+// runEventSubscriber keeps a long-lived VICI session subscribed to the
+// strongSwan event stream, publishing every event onto globalEventBus. It
+// redials with exponential backoff whenever the session drops.
+func runEventSubscriber(ctx context.Context) {
+	backoff := time.Second
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		sess, err := viciSession()
+		if err != nil {
+			log.Printf("events: vici connect failed: %v", err)
+			backoff = sleepBackoff(ctx, backoff)
+			continue
+		}
+
+		if err := sess.Subscribe(eventNames...); err != nil {
+			log.Printf("events: subscribe failed: %v", err)
+			sess.Close()
+			backoff = sleepBackoff(ctx, backoff)
+			continue
+		}
+
+		backoff = time.Second
+		for {
+			ev, err := sess.NextEvent(ctx)
+			if err != nil {
+				log.Printf("events: session lost: %v", err)
+				break
+			}
+			globalEventBus.publish(ev.Name, ev.Message)
+		}
+		sess.Close()
+	}
+}
+
+func sleepBackoff(ctx context.Context, d time.Duration) time.Duration {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+	d *= 2
+	if d > 30*time.Second {
+		d = 30 * time.Second
+	}
+	return d
+}
+
+//
+// ----------- /events/ws and /events/sse -----------
+//
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+func eventsWSHandler(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	ch, backlog := globalEventBus.subscribe()
+	defer globalEventBus.unsubscribe(ch)
+
+	for _, ev := range backlog {
+		if conn.WriteJSON(ev) != nil {
+			return
+		}
+	}
+	for ev := range ch {
+		if conn.WriteJSON(ev) != nil {
+			return
+		}
+	}
+}
+
+func eventsSSEHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch, backlog := globalEventBus.subscribe()
+	defer globalEventBus.unsubscribe(ch)
+
+	if lastID, err := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+		backlog = globalEventBus.since(lastID)
+	}
+	for _, ev := range backlog {
+		writeSSEEvent(w, ev)
+	}
+	flusher.Flush()
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			writeSSEEvent(w, ev)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func writeSSEEvent(w http.ResponseWriter, ev Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Name, ev.Data)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChildStatsOmitsSinceWhenUnknown(t *testing.T) {
+	st := ChildStats{Active: true, InBytes: 10}
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if strings.Contains(string(data), `"since"`) {
+		t.Fatalf("expected no \"since\" key when Since is unset, got %s", data)
+	}
+}
+
+func TestChildStatsIncludesSinceWhenKnown(t *testing.T) {
+	since := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	st := ChildStats{Active: true, Since: &since}
+	data, err := json.Marshal(st)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"since":"2026-01-02T03:04:05Z"`) {
+		t.Fatalf("expected the configured Since to be serialized, got %s", data)
+	}
+}
@@ -0,0 +1,150 @@
+// This file contains the /metrics endpoint: Prometheus gauges/counters
+// derived from the same VICI data backing /status_json, refreshed on a
+// timer rather than per scrape so /metrics stays cheap to hit often.
+
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const defaultMetricsInterval = 10 * time.Second
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	childInBytesMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "govpnui_child_in_bytes_total",
+		Help: "Bytes received on a CHILD_SA, as last reported by list-sas.",
+	}, []string{"child"})
+
+	childOutBytesMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "govpnui_child_out_bytes_total",
+		Help: "Bytes sent on a CHILD_SA, as last reported by list-sas.",
+	}, []string{"child"})
+
+	childInPacketsMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "govpnui_child_in_packets_total",
+		Help: "Packets received on a CHILD_SA, as last reported by list-sas.",
+	}, []string{"child"})
+
+	childOutPacketsMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "govpnui_child_out_packets_total",
+		Help: "Packets sent on a CHILD_SA, as last reported by list-sas.",
+	}, []string{"child"})
+
+	childActiveMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "govpnui_child_active",
+		Help: "1 if the CHILD_SA is INSTALLED, 0 otherwise.",
+	}, []string{"child"})
+
+	ikeUptimeMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "govpnui_ike_sa_uptime_seconds",
+		Help: "Seconds since the IKE_SA was established.",
+	}, []string{"ike_sa"})
+
+	ikeRekeysMetric = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "govpnui_ike_sa_rekeys_total",
+		Help: "Count of ike-rekey events observed for an IKE_SA.",
+	}, []string{"ike_sa"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		childInBytesMetric,
+		childOutBytesMetric,
+		childInPacketsMetric,
+		childOutPacketsMetric,
+		childActiveMetric,
+		ikeUptimeMetric,
+		ikeRekeysMetric,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+}
+
+var metricsHandler = promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+
+// runMetricsScraper refreshes the gauges above from VICI on a fixed
+// interval, instead of shelling out (or opening a VICI session) per scrape.
+func runMetricsScraper(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultMetricsInterval
+	}
+	scrapeMetricsOnce()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			scrapeMetricsOnce()
+		}
+	}
+}
+
+func scrapeMetricsOnce() {
+	sess, err := viciSession()
+	if err != nil {
+		log.Printf("metrics: vici connect failed: %v", err)
+		return
+	}
+	defer sess.Close()
+
+	sas, err := viciListSas(sess)
+	if err != nil {
+		log.Printf("metrics: list-sas failed: %v", err)
+		return
+	}
+
+	applyMetrics(sas)
+}
+
+// applyMetrics repopulates the per-child/per-IKE-SA gauges from a fresh
+// list-sas result. It's split out from scrapeMetricsOnce so the stale-label
+// behavior can be tested without a VICI session.
+func applyMetrics(sas []IKESA) {
+	// Reset every gauge vec before repopulating it below, so an SA or child
+	// that disappeared since the last scrape (torn down, or removed via
+	// /conn/delete) drops out of /metrics instead of being stuck reporting
+	// its last known value forever. ikeRekeysMetric is a counter driven by
+	// events rather than this scrape, so it's untouched.
+	childInBytesMetric.Reset()
+	childOutBytesMetric.Reset()
+	childInPacketsMetric.Reset()
+	childOutPacketsMetric.Reset()
+	childActiveMetric.Reset()
+	ikeUptimeMetric.Reset()
+
+	now := time.Now().Unix()
+	for _, ike := range sas {
+		ikeUptimeMetric.WithLabelValues(ike.Name).Set(float64(now - ike.Established))
+
+		for name, c := range ike.Children {
+			childInBytesMetric.WithLabelValues(name).Set(float64(c.BytesIn))
+			childOutBytesMetric.WithLabelValues(name).Set(float64(c.BytesOut))
+			childInPacketsMetric.WithLabelValues(name).Set(float64(c.PacketsIn))
+			childOutPacketsMetric.WithLabelValues(name).Set(float64(c.PacketsOut))
+
+			active := 0.0
+			if c.State == "INSTALLED" {
+				active = 1
+			}
+			childActiveMetric.WithLabelValues(name).Set(active)
+		}
+	}
+}
+
+// recordIKERekeyEvent is called from the event subscriber (see events.go)
+// whenever an ike-rekey event arrives, so the rekey counter doesn't have to
+// wait for the next scrape interval.
+func recordIKERekeyEvent(ikeName string) {
+	ikeRekeysMetric.WithLabelValues(ikeName).Inc()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// collectGaugeValues reads every currently-exported series of a GaugeVec,
+// keyed by its single label value. Unlike WithLabelValues, this doesn't
+// create a series as a side effect of looking for one.
+func collectGaugeValues(t *testing.T, vec *prometheus.GaugeVec) map[string]float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 64)
+	vec.Collect(ch)
+	close(ch)
+
+	out := make(map[string]float64)
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatalf("write metric: %v", err)
+		}
+		if len(pb.Label) != 1 {
+			t.Fatalf("expected exactly one label, got %d", len(pb.Label))
+		}
+		out[pb.Label[0].GetValue()] = pb.Gauge.GetValue()
+	}
+	return out
+}
+
+func TestApplyMetricsClearsStaleLabels(t *testing.T) {
+	applyMetrics([]IKESA{
+		{Name: "ike-1", Children: map[string]ChildSA{
+			"net-a": {State: "INSTALLED", BytesIn: 100},
+		}},
+	})
+	values := collectGaugeValues(t, childActiveMetric)
+	if values["net-a"] != 1 {
+		t.Fatalf("net-a active = %v, want 1", values["net-a"])
+	}
+
+	// net-a is gone from this scrape; its series should disappear rather
+	// than keep reporting its last value.
+	applyMetrics([]IKESA{
+		{Name: "ike-1", Children: map[string]ChildSA{
+			"net-b": {State: "INSTALLED", BytesIn: 200},
+		}},
+	})
+
+	values = collectGaugeValues(t, childActiveMetric)
+	if _, ok := values["net-a"]; ok {
+		t.Error("stale label \"net-a\" still present after it dropped out of list-sas")
+	}
+	if values["net-b"] != 1 {
+		t.Fatalf("net-b active = %v, want 1", values["net-b"])
+	}
+}
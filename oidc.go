@@ -0,0 +1,276 @@
+// This file contains the OIDC glue: discovery, ID token verification
+// against the provider's JWKS, and the /login/oidc, /oidc/callback, and
+// /logout handlers that sit on top of the authenticator in auth.go.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// oidcStateCookie holds the CSRF state value between /login/oidc and
+// /oidc/callback.
+const oidcStateCookie = "govpnui_oidc_state"
+
+// oidcVerifier holds an OIDC provider's discovered endpoints and the JWKS
+// used to verify ID tokens it issues.
+type oidcVerifier struct {
+	IssuerURL string
+	Endpoint  oauth2.Endpoint
+	jwksURL   string
+}
+
+type oidcDiscoveryDoc struct {
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+func newOIDCVerifier(issuerURL string) (*oidcVerifier, error) {
+	discoveryURL, err := url.JoinPath(issuerURL, ".well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.Get(discoveryURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch discovery doc: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var doc oidcDiscoveryDoc
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("decode discovery doc: %w", err)
+	}
+
+	return &oidcVerifier{
+		IssuerURL: issuerURL,
+		jwksURL:   doc.JWKSURI,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  doc.AuthorizationEndpoint,
+			TokenURL: doc.TokenEndpoint,
+		},
+	}, nil
+}
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// keyFunc fetches the provider's JWKS and returns the RSA public key
+// matching the ID token's "kid" header.
+func (v *oidcVerifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	resp, err := http.Get(v.jwksURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var set jwks
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	for _, k := range set.Keys {
+		if k.Kid != kid || k.Kty != "RSA" {
+			continue
+		}
+		return rsaPublicKeyFromJWK(k)
+	}
+	return nil, fmt.Errorf("no jwks key matching kid %q", kid)
+}
+
+func rsaPublicKeyFromJWK(k jwk) (*rsa.PublicKey, error) {
+	nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nBytes),
+		E: int(new(big.Int).SetBytes(eBytes).Int64()),
+	}, nil
+}
+
+// idTokenClaims is the subset of standard OIDC ID token claims we need.
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+}
+
+// verifyIDToken checks the ID token's signature, expiry, issuer, and
+// audience. Checking only the signature would let a token minted by the
+// same IdP for a completely different client application be accepted here.
+func (v *oidcVerifier) verifyIDToken(raw, clientID string) (*idTokenClaims, error) {
+	var claims idTokenClaims
+	token, err := jwt.ParseWithClaims(raw, &claims, v.keyFunc)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if claims.Issuer != v.IssuerURL {
+		return nil, fmt.Errorf("id_token issuer %q does not match configured issuer %q", claims.Issuer, v.IssuerURL)
+	}
+	if !audienceContains(claims.Audience, clientID) {
+		return nil, fmt.Errorf("id_token audience %v does not include client id %q", claims.Audience, clientID)
+	}
+	return &claims, nil
+}
+
+func audienceContains(aud jwt.ClaimStrings, clientID string) bool {
+	for _, a := range aud {
+		if a == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// newOIDCState generates a random CSRF state value for the login flow.
+func newOIDCState() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("generate oidc state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+//
+// ----------- /login/oidc and /oidc/callback -----------
+//
+
+// oidcLoginHandler redirects the browser to the provider's authorization
+// endpoint, stashing a random CSRF state value in a short-lived cookie for
+// oidcCallbackHandler to check against.
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if globalAuth == nil || globalAuth.oauth2Conf == nil {
+		http.Error(w, "oidc not configured", http.StatusNotImplemented)
+		return
+	}
+	state, err := newOIDCState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   globalAuth.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   300,
+	})
+	http.Redirect(w, r, globalAuth.oauth2Conf.AuthCodeURL(state), http.StatusFound)
+}
+
+// oidcCallbackHandler exchanges the auth code, verifies the ID token, maps
+// the subject to a role via the local user store, and issues a session
+// cookie backed by sessionClaims (see auth.go).
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if globalAuth == nil || globalAuth.oauth2Conf == nil {
+		http.Error(w, "oidc not configured", http.StatusNotImplemented)
+		return
+	}
+
+	stateCookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		http.Error(w, "missing oidc state cookie", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/", MaxAge: -1})
+	if state := r.URL.Query().Get("state"); state == "" ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(stateCookie.Value)) != 1 {
+		http.Error(w, "invalid oidc state", http.StatusBadRequest)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		http.Error(w, "missing code", http.StatusBadRequest)
+		return
+	}
+
+	token, err := globalAuth.oauth2Conf.Exchange(r.Context(), code)
+	if err != nil {
+		http.Error(w, "token exchange failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		http.Error(w, "token response missing id_token", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := globalAuth.oidcProvider.verifyIDToken(rawIDToken, globalAuth.cfg.OIDC.ClientID)
+	if err != nil {
+		http.Error(w, "id_token verification failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	globalAuth.mu.RLock()
+	user, known := globalAuth.users[claims.Subject]
+	globalAuth.mu.RUnlock()
+	if !known {
+		http.Error(w, "no local role mapping for subject "+claims.Subject, http.StatusForbidden)
+		return
+	}
+	role, err := parseRole(user.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	globalAuth.issueSessionCookie(w, principal{
+		Username:   claims.Subject,
+		Role:       role,
+		ChildGlobs: user.ChildGlobs,
+		Method:     "oidc",
+	})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// loginHandler authenticates a username/password pair against the local
+// user store and, on success, issues a session cookie.
+func loginHandler(w http.ResponseWriter, r *http.Request) {
+	if globalAuth == nil {
+		http.Error(w, "auth not configured", http.StatusNotImplemented)
+		return
+	}
+	username := r.FormValue("username")
+	password := r.FormValue("password")
+
+	p, err := globalAuth.authenticateLocal(username, password)
+	if err != nil {
+		http.Error(w, "login failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	globalAuth.issueSessionCookie(w, p)
+	w.Write([]byte("ok\n"))
+}
+
+func logoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: "govpnui_session", Path: "/", MaxAge: -1})
+	w.Write([]byte("ok\n"))
+}
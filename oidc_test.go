@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAudienceContains(t *testing.T) {
+	cases := []struct {
+		aud      jwt.ClaimStrings
+		clientID string
+		want     bool
+	}{
+		{jwt.ClaimStrings{"govpnui"}, "govpnui", true},
+		{jwt.ClaimStrings{"other-app", "govpnui"}, "govpnui", true},
+		{jwt.ClaimStrings{"other-app"}, "govpnui", false},
+		{nil, "govpnui", false},
+	}
+	for _, c := range cases {
+		if got := audienceContains(c.aud, c.clientID); got != c.want {
+			t.Errorf("audienceContains(%v, %q) = %v, want %v", c.aud, c.clientID, got, c.want)
+		}
+	}
+}
+
+func TestNewOIDCStateIsUniqueAndNonEmpty(t *testing.T) {
+	a, err := newOIDCState()
+	if err != nil {
+		t.Fatalf("newOIDCState: %v", err)
+	}
+	b, err := newOIDCState()
+	if err != nil {
+		t.Fatalf("newOIDCState: %v", err)
+	}
+	if a == "" || b == "" {
+		t.Fatal("newOIDCState returned an empty value")
+	}
+	if a == b {
+		t.Fatal("newOIDCState returned the same value twice")
+	}
+}
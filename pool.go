@@ -0,0 +1,218 @@
+// This file contains the VICI session pool and its context/deadline
+// plumbing. viciSession() used to open a fresh Unix-socket session per
+// /initiate or /terminate call with no timeout on CommandRequest, so a
+// stuck charon could wedge HTTP goroutines indefinitely. viciDo pools
+// sessions and honors the caller's context deadline the way net.Conn does:
+// a deadlineTimer whose cancel channel is closed when the deadline fires,
+// re-armed on each call, and selected against so the caller returns
+// promptly while the underlying command goroutine drains in the background.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	vici "github.com/strongswan/govici/vici"
+)
+
+const defaultPoolSize = 4
+
+// defaultCommandTimeout bounds how long viciDo will wait when the caller's
+// context carries no deadline of its own (e.g. a plain r.Context() from an
+// HTTP handler with no server-side read/write timeouts configured) - without
+// it, a wedged charon would block the calling goroutine indefinitely, which
+// is exactly what pooling VICI sessions was meant to fix.
+const defaultCommandTimeout = 10 * time.Second
+
+// ErrPoolExhausted is returned by viciDo when every pool slot is busy and
+// ctx doesn't grant enough time for one to free up.
+var ErrPoolExhausted = errors.New("vici session pool exhausted")
+
+//
+// ----------- deadlineTimer -----------
+//
+
+// deadlineTimer mirrors the pattern net.Conn implementations use for
+// SetDeadline: done() is closed when the deadline fires, and setDeadline
+// re-arms it with a fresh channel rather than accumulating timers.
+type deadlineTimer struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func newDeadlineTimer() *deadlineTimer {
+	return &deadlineTimer{cancel: make(chan struct{})}
+}
+
+func (d *deadlineTimer) done() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.cancel
+}
+
+// setDeadline arms the timer to close done() at t. A zero t disarms it.
+func (d *deadlineTimer) setDeadline(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.cancel = make(chan struct{})
+	if t.IsZero() {
+		d.timer = nil
+		return
+	}
+
+	cancel := d.cancel
+	d.timer = time.AfterFunc(time.Until(t), func() {
+		close(cancel)
+	})
+}
+
+//
+// ----------- session pool -----------
+//
+
+// pooledSession pairs a VICI session with the mutex that serializes
+// commands against it; a vici.Session isn't safe for concurrent use.
+type pooledSession struct {
+	mu   sync.Mutex
+	sess *vici.Session
+}
+
+// sessionPool hands out VICI sessions to callers, dialing lazily and
+// dropping sessions that a command call reported unhealthy.
+type sessionPool struct {
+	sem  chan struct{}
+	mu   sync.Mutex
+	idle []*pooledSession
+}
+
+var globalSessionPool = newSessionPool(defaultPoolSize)
+
+func newSessionPool(size int) *sessionPool {
+	if size <= 0 {
+		size = defaultPoolSize
+	}
+	return &sessionPool{sem: make(chan struct{}, size)}
+}
+
+// acquire reserves a pool slot, respecting ctx, and returns a session -
+// an idle one if one's available, or a freshly dialed one otherwise.
+func (p *sessionPool) acquire(ctx context.Context) (*pooledSession, error) {
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		// Every slot was still in use when ctx gave up waiting for one -
+		// this is the pool-exhaustion case, distinct from a dial failure
+		// below, which has nothing to do with how full the pool is.
+		return nil, fmt.Errorf("%w: %v", ErrPoolExhausted, ctx.Err())
+	}
+
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		ps := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return ps, nil
+	}
+	p.mu.Unlock()
+
+	sess, err := viciSession()
+	if err != nil {
+		<-p.sem
+		return nil, fmt.Errorf("vici connect failed: %w", err)
+	}
+	return &pooledSession{sess: sess}, nil
+}
+
+// release returns ps to the idle list, or closes it (and frees its slot)
+// if the caller reports it's no longer healthy.
+func (p *sessionPool) release(ps *pooledSession, healthy bool) {
+	if !healthy {
+		ps.sess.Close()
+		<-p.sem
+		return
+	}
+	p.mu.Lock()
+	p.idle = append(p.idle, ps)
+	p.mu.Unlock()
+	<-p.sem
+}
+
+//
+// ----------- viciDo -----------
+//
+
+// viciDo runs cmd/msg against a pooled session, honoring ctx's deadline.
+// The command itself runs in a goroutine so a wedged charon can't block
+// the caller past the deadline: viciDo selects between the command
+// finishing, ctx being done, and a deadlineTimer armed from ctx's own
+// deadline (kept separate so future callers can plumb in a per-call
+// deadline that's tighter than ctx's).
+func viciDo(ctx context.Context, cmd string, msg *vici.Message) (*vici.Message, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, defaultCommandTimeout)
+		defer cancel()
+	}
+
+	ps, err := globalSessionPool.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dt := newDeadlineTimer()
+	if deadline, ok := ctx.Deadline(); ok {
+		dt.setDeadline(deadline)
+	}
+
+	type result struct {
+		msg *vici.Message
+		err error
+	}
+	done := make(chan result, 1)
+
+	ps.mu.Lock()
+	go func() {
+		defer ps.mu.Unlock()
+		m, cmdErr := ps.sess.CommandRequest(cmd, msg)
+		done <- result{m, cmdErr}
+	}()
+
+	select {
+	case r := <-done:
+		globalSessionPool.release(ps, r.err == nil)
+		return r.msg, r.err
+	case <-ctx.Done():
+		// The command goroutine is still draining against ps; closing the
+		// session on release unblocks it rather than leaking the goroutine.
+		globalSessionPool.release(ps, false)
+		return nil, ctx.Err()
+	case <-dt.done():
+		globalSessionPool.release(ps, false)
+		return nil, context.DeadlineExceeded
+	}
+}
+
+// writeVICIError maps a viciDo error to the right HTTP status: 503 when the
+// pool itself was exhausted, 504 when the caller's deadline tripped against
+// an in-flight command, 500 otherwise (including a dial failure, which is a
+// real connectivity problem rather than the pool being full).
+func writeVICIError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrPoolExhausted):
+		http.Error(w, "vici session pool exhausted: "+err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "vici command timed out: "+err.Error(), http.StatusGatewayTimeout)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
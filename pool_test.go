@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDeadlineTimerFires(t *testing.T) {
+	dt := newDeadlineTimer()
+	dt.setDeadline(time.Now().Add(10 * time.Millisecond))
+
+	select {
+	case <-dt.done():
+	case <-time.After(time.Second):
+		t.Fatal("deadlineTimer did not fire within 1s of its deadline")
+	}
+}
+
+func TestDeadlineTimerZeroDisarms(t *testing.T) {
+	dt := newDeadlineTimer()
+	dt.setDeadline(time.Now().Add(10 * time.Millisecond))
+	dt.setDeadline(time.Time{})
+
+	select {
+	case <-dt.done():
+		t.Fatal("deadlineTimer fired after being disarmed with a zero deadline")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDeadlineTimerRearms(t *testing.T) {
+	dt := newDeadlineTimer()
+	dt.setDeadline(time.Now().Add(time.Hour))
+	first := dt.done()
+
+	dt.setDeadline(time.Now().Add(10 * time.Millisecond))
+	second := dt.done()
+
+	select {
+	case <-first:
+		t.Fatal("stale done() channel from before re-arming fired")
+	default:
+	}
+
+	select {
+	case <-second:
+	case <-time.After(time.Second):
+		t.Fatal("re-armed deadlineTimer did not fire within 1s of its new deadline")
+	}
+}
+
+func TestAcquireReportsPoolExhaustionNotDialFailure(t *testing.T) {
+	p := newSessionPool(1)
+	p.sem <- struct{}{} // fill the only slot so acquire has to wait on ctx
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := p.acquire(ctx)
+	if err == nil {
+		t.Fatal("expected an error from a full pool, got nil")
+	}
+	if !errors.Is(err, ErrPoolExhausted) {
+		t.Fatalf("acquire() on a full pool = %v, want an error wrapping ErrPoolExhausted", err)
+	}
+}
@@ -0,0 +1,191 @@
+// This file contains the VICI data model and the commands used to populate it.
+// It replaces the old approach of shelling out to the swanctl CLI and regexing
+// its output: we talk directly to charon over the VICI Unix socket and decode
+// the responses into typed structs.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	vici "github.com/strongswan/govici/vici"
+)
+
+//
+// ----------- VICI data model -----------
+//
+
+// ChildSA mirrors one entry of an IKE_SA's "child-sas" section, as returned
+// by a list-sas request.
+type ChildSA struct {
+	Name        string
+	Reqid       string `vici:"reqid"`
+	State       string `vici:"state"`
+	Mode        string `vici:"mode"`
+	Protocol    string `vici:"protocol"`
+	Encap       string `vici:"encap"`
+	SPIIn       string `vici:"spi-in"`
+	SPIOut      string `vici:"spi-out"`
+	EncrAlg     string `vici:"encr-alg"`
+	IntegAlg    string `vici:"integ-alg"`
+	BytesIn     int64  `vici:"bytes-in,string"`
+	BytesOut    int64  `vici:"bytes-out,string"`
+	PacketsIn   int64  `vici:"packets-in,string"`
+	PacketsOut  int64  `vici:"packets-out,string"`
+	InstallTime int64  `vici:"install-time,string"`
+	RekeyTime   int64  `vici:"rekey-time,string"`
+}
+
+// IKESA mirrors one IKE_SA entry (and its CHILD_SAs), as returned by a
+// list-sas request.
+type IKESA struct {
+	Name        string
+	UniqueID    string `vici:"uniqueid"`
+	Version     string `vici:"version"`
+	State       string `vici:"state"`
+	LocalHost   string `vici:"local-host"`
+	RemoteHost  string `vici:"remote-host"`
+	RemoteID    string `vici:"remote-id"`
+	Established int64  `vici:"established,string"`
+	ReauthTime  int64  `vici:"reauth-time,string"`
+	RekeyTime   int64  `vici:"rekey-time,string"`
+	Children    map[string]ChildSA
+}
+
+// Conn mirrors one entry of a list-conns request. Children only carries the
+// child config names; load-conn payloads are handled separately.
+type Conn struct {
+	Name        string
+	Version     string   `vici:"version"`
+	LocalAddrs  []string `vici:"local_addrs"`
+	RemoteAddrs []string `vici:"remote_addrs"`
+	Children    []string
+}
+
+//
+// ----------- VICI commands -----------
+//
+
+// viciListSas issues a list-sas request and decodes every streamed IKE_SA
+// (and its CHILD_SAs) into the typed model above.
+func viciListSas(sess *vici.Session) ([]IKESA, error) {
+	stream, err := sess.StreamedCommandRequest("list-sas", "list-sa", vici.NewMessage())
+	if err != nil {
+		return nil, fmt.Errorf("list-sas: %w", err)
+	}
+
+	var out []IKESA
+	for _, msg := range stream.Messages() {
+		for _, name := range msg.Keys() {
+			raw, ok := msg.Get(name).(*vici.Message)
+			if !ok {
+				continue
+			}
+			ike, err := decodeIKESA(name, raw)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ike)
+		}
+	}
+	return out, nil
+}
+
+func decodeIKESA(name string, msg *vici.Message) (IKESA, error) {
+	var ike IKESA
+	if err := vici.UnmarshalMessage(msg, &ike); err != nil {
+		return ike, fmt.Errorf("decode ike-sa %q: %w", name, err)
+	}
+	ike.Name = name
+
+	raw, ok := msg.Get("child-sas").(*vici.Message)
+	if !ok {
+		return ike, nil
+	}
+	ike.Children = make(map[string]ChildSA, len(raw.Keys()))
+	for _, cname := range raw.Keys() {
+		cmsg, ok := raw.Get(cname).(*vici.Message)
+		if !ok {
+			continue
+		}
+		var child ChildSA
+		if err := vici.UnmarshalMessage(cmsg, &child); err != nil {
+			return ike, fmt.Errorf("decode child-sa %q: %w", cname, err)
+		}
+		child.Name = cname
+		ike.Children[cname] = child
+	}
+	return ike, nil
+}
+
+// viciListConns issues a list-conns request and decodes every streamed
+// connection into the typed model above.
+func viciListConns(sess *vici.Session) ([]Conn, error) {
+	stream, err := sess.StreamedCommandRequest("list-conns", "list-conn", vici.NewMessage())
+	if err != nil {
+		return nil, fmt.Errorf("list-conns: %w", err)
+	}
+
+	var out []Conn
+	for _, msg := range stream.Messages() {
+		for _, name := range msg.Keys() {
+			raw, ok := msg.Get(name).(*vici.Message)
+			if !ok {
+				continue
+			}
+			var c Conn
+			if err := vici.UnmarshalMessage(raw, &c); err != nil {
+				return nil, fmt.Errorf("decode conn %q: %w", name, err)
+			}
+			c.Name = name
+			if children, ok := raw.Get("children").(*vici.Message); ok {
+				c.Children = children.Keys()
+			}
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// viciStats issues a stats request for the raw daemon counters.
+func viciStats(sess *vici.Session) (*vici.Message, error) {
+	msg, err := sess.CommandRequest("stats", vici.NewMessage())
+	if err != nil {
+		return nil, fmt.Errorf("stats: %w", err)
+	}
+	return msg, nil
+}
+
+//
+// ----------- Pretty-printed text renderings -----------
+//
+
+// renderStatusText renders a list-sas result the way `swanctl --list-sas`
+// used to, for the text endpoints and for humans poking at the API directly.
+func renderStatusText(sas []IKESA) string {
+	var b strings.Builder
+	for _, ike := range sas {
+		fmt.Fprintf(&b, "%s: #%s, %s, IKEv%s, %s[%s]...%s[%s]\n",
+			ike.Name, ike.UniqueID, ike.State, ike.Version, ike.LocalHost, ike.Name, ike.RemoteHost, ike.RemoteID)
+		for _, c := range ike.Children {
+			fmt.Fprintf(&b, "  %s: #%s, reqid %s, %s, %s\n", c.Name, c.SPIIn, c.Reqid, c.State, c.Mode)
+			fmt.Fprintf(&b, "    in  %s, %d bytes, %d packets\n", c.SPIIn, c.BytesIn, c.PacketsIn)
+			fmt.Fprintf(&b, "    out %s, %d bytes, %d packets\n", c.SPIOut, c.BytesOut, c.PacketsOut)
+		}
+	}
+	return b.String()
+}
+
+// renderConnsText renders a list-conns result the way
+// `swanctl --list-conns` used to.
+func renderConnsText(conns []Conn) string {
+	var b strings.Builder
+	for _, c := range conns {
+		fmt.Fprintf(&b, "%s: %s...%s\n", c.Name, strings.Join(c.LocalAddrs, ","), strings.Join(c.RemoteAddrs, ","))
+		if len(c.Children) > 0 {
+			fmt.Fprintf(&b, "  children: %s\n", strings.Join(c.Children, ", "))
+		}
+	}
+	return b.String()
+}